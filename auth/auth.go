@@ -0,0 +1,54 @@
+// Package auth authenticates users against a pluggable identity backend, so
+// operators can swap the bundled users.json file for an existing IMAP, PAM,
+// or LDAP directory instead of maintaining a separate password store.
+package auth
+
+import (
+	"fmt"
+	"os"
+)
+
+// Provider authenticates a username/password pair against some identity
+// backend.
+type Provider interface {
+	// Authenticate reports whether user/pass is a valid credential pair.
+	// A false result with a nil error means the credentials were rejected;
+	// a non-nil error means the backend itself couldn't be reached.
+	Authenticate(user, pass string) (bool, error)
+}
+
+// FromEnv builds the Provider selected by the MM_AUTH environment variable,
+// defaulting to the local JSON file backend when unset. Each backend reads
+// its own settings from further environment variables:
+//
+//	MM_AUTH=file (default)  userFile is the path to the bcrypt-hashed JSON credentials file.
+//	MM_AUTH=imap            MM_IMAP_ADDR=host:port (required), MM_IMAP_TLS=1 to dial over TLS.
+//	MM_AUTH=ldap            MM_LDAP_ADDR=host:port, MM_LDAP_BIND_DN=uid=%s,ou=people,dc=example,dc=com (both required).
+//	MM_AUTH=pam             MM_PAM_SERVICE=name, defaulting to "missing-minutes".
+func FromEnv(userFile string) (Provider, error) {
+	switch backend := os.Getenv("MM_AUTH"); backend {
+	case "", "file":
+		return NewFileProvider(userFile)
+	case "imap":
+		addr := os.Getenv("MM_IMAP_ADDR")
+		if addr == "" {
+			return nil, fmt.Errorf("auth: MM_AUTH=imap requires MM_IMAP_ADDR")
+		}
+		return NewIMAPProvider(addr, os.Getenv("MM_IMAP_TLS") != ""), nil
+	case "ldap":
+		addr := os.Getenv("MM_LDAP_ADDR")
+		bindDNFmt := os.Getenv("MM_LDAP_BIND_DN")
+		if addr == "" || bindDNFmt == "" {
+			return nil, fmt.Errorf("auth: MM_AUTH=ldap requires MM_LDAP_ADDR and MM_LDAP_BIND_DN")
+		}
+		return NewLDAPProvider(addr, bindDNFmt), nil
+	case "pam":
+		service := os.Getenv("MM_PAM_SERVICE")
+		if service == "" {
+			service = "missing-minutes"
+		}
+		return NewPAMProvider(service), nil
+	default:
+		return nil, fmt.Errorf("auth: unknown MM_AUTH backend %q", backend)
+	}
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-sasl"
+)
+
+// IMAPProvider authenticates by attempting a SASL PLAIN login against a
+// configured IMAP server; credentials are valid exactly when the server
+// accepts the login.
+type IMAPProvider struct {
+	Addr string // host:port
+	TLS  bool
+}
+
+// NewIMAPProvider returns a Provider that authenticates against the IMAP
+// server at addr, connecting over TLS when useTLS is set.
+func NewIMAPProvider(addr string, useTLS bool) *IMAPProvider {
+	return &IMAPProvider{Addr: addr, TLS: useTLS}
+}
+
+func (p *IMAPProvider) Authenticate(user, pass string) (bool, error) {
+	if user == "" || pass == "" {
+		// Some IMAP servers permit a PLAIN login with an empty password as
+		// an anonymous/guest login; reject it up front rather than let that
+		// read as a valid one.
+		return false, nil
+	}
+
+	var c *client.Client
+	var err error
+	if p.TLS {
+		host, _, splitErr := net.SplitHostPort(p.Addr)
+		if splitErr != nil {
+			host = p.Addr
+		}
+		c, err = client.DialTLS(p.Addr, &tls.Config{ServerName: host})
+	} else {
+		c, err = client.Dial(p.Addr)
+	}
+	if err != nil {
+		return false, fmt.Errorf("auth: imap dial %s: %w", p.Addr, err)
+	}
+	defer c.Logout()
+
+	if err := c.Authenticate(sasl.NewPlainClient("", user, pass)); err != nil {
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,23 @@
+//go:build !pam
+
+package auth
+
+import "fmt"
+
+// PAMProvider is the default stub used when the binary is built without the
+// "pam" tag (see pam.go). It always fails with an explanatory error, since
+// github.com/msteinert/pam needs cgo and libpam's development headers,
+// which aren't guaranteed to be present at build time.
+type PAMProvider struct {
+	Service string
+}
+
+// NewPAMProvider returns a Provider for the named PAM service. Rebuild with
+// -tags pam (and libpam-dev installed) to get a working implementation.
+func NewPAMProvider(service string) *PAMProvider {
+	return &PAMProvider{Service: service}
+}
+
+func (p *PAMProvider) Authenticate(user, pass string) (bool, error) {
+	return false, fmt.Errorf("auth: PAM support not compiled in; rebuild with -tags pam")
+}
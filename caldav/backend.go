@@ -0,0 +1,298 @@
+// Package caldav implements a minimal CalDAV (RFC 4791) server on top of a
+// pluggable Backend, so missing-minutes can be synced with clients such as
+// Thunderbird, Apple Calendar and DAVx5 instead of only serving flat .ics
+// files.
+package caldav
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+// ErrPreconditionFailed is returned by PutObjectIfMatch when the caller's
+// If-Match/If-None-Match expectations don't hold, so callers can answer with
+// 412 Precondition Failed.
+var ErrPreconditionFailed = errors.New("caldav: precondition failed")
+
+// ETag computes the ETag CalDAV uses to detect concurrent edits: a SHA-1
+// hash of the object's raw bytes, quoted per RFC 7232.
+func ETag(data []byte) string {
+	sum := sha1.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// Calendar describes a single calendar collection owned by a principal.
+type Calendar struct {
+	// Name is the last path segment of the collection, e.g. "work".
+	Name string
+	// DisplayName is a human-readable name; defaults to Name when unset.
+	DisplayName string
+}
+
+// Object is a single calendar object (currently always a VEVENT) stored as
+// raw iCalendar bytes.
+type Object struct {
+	UID  string
+	Data []byte
+}
+
+// Backend abstracts calendar storage so the CalDAV handler isn't tied to the
+// filesystem layout used by the legacy flat-file endpoints.
+type Backend interface {
+	// ListCalendars returns the calendars under a principal's calendar home.
+	ListCalendars(ctx context.Context, principal string) ([]Calendar, error)
+	// GetCalendar returns metadata for a single calendar collection.
+	GetCalendar(ctx context.Context, principal, calendar string) (*Calendar, error)
+	// CreateCalendar creates a new, empty calendar collection.
+	CreateCalendar(ctx context.Context, principal, calendar string) error
+	// DeleteCalendar removes a calendar collection and everything in it.
+	DeleteCalendar(ctx context.Context, principal, calendar string) error
+
+	// ListObjects returns every calendar object stored in a calendar.
+	ListObjects(ctx context.Context, principal, calendar string) ([]Object, error)
+	// GetObject returns a single calendar object by UID.
+	GetObject(ctx context.Context, principal, calendar, uid string) (*Object, error)
+	// PutObject creates or replaces a calendar object.
+	PutObject(ctx context.Context, principal, calendar, uid string, data []byte) error
+	// PutObjectIfMatch creates or replaces a calendar object, honoring
+	// If-Match/If-None-Match preconditions, and returns the new ETag.
+	// ifNoneMatch == "*" means "only create, never replace". An empty
+	// ifMatch/ifNoneMatch skips the corresponding check. Returns
+	// ErrPreconditionFailed if a precondition doesn't hold.
+	PutObjectIfMatch(ctx context.Context, principal, calendar, uid string, data []byte, ifMatch, ifNoneMatch string) (string, error)
+	// DeleteObject removes a calendar object by UID.
+	DeleteObject(ctx context.Context, principal, calendar, uid string) error
+}
+
+// FilesystemBackend stores calendars as directories of per-event .ics files
+// under RootDir/{principal}/{calendar}/{uid}.ics.
+type FilesystemBackend struct {
+	RootDir string
+}
+
+// NewFilesystemBackend returns a Backend rooted at rootDir.
+func NewFilesystemBackend(rootDir string) *FilesystemBackend {
+	return &FilesystemBackend{RootDir: rootDir}
+}
+
+func (b *FilesystemBackend) calendarDir(principal, calendar string) string {
+	return filepath.Join(b.RootDir, filepath.Clean("/"+principal), filepath.Clean("/"+calendar))
+}
+
+func (b *FilesystemBackend) objectPath(principal, calendar, uid string) string {
+	return filepath.Join(b.calendarDir(principal, calendar), filepath.Clean("/"+uid)+".ics")
+}
+
+func (b *FilesystemBackend) ListCalendars(ctx context.Context, principal string) ([]Calendar, error) {
+	userDir := filepath.Join(b.RootDir, filepath.Clean("/"+principal))
+	entries, err := os.ReadDir(userDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cals []Calendar
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			// Dot-directories are reserved for non-calendar state stored
+			// alongside a user's calendars (e.g. sync's ".tokens"), not
+			// collections to expose over CalDAV.
+			cals = append(cals, Calendar{Name: e.Name(), DisplayName: e.Name()})
+		}
+	}
+	sort.Slice(cals, func(i, j int) bool { return cals[i].Name < cals[j].Name })
+	return cals, nil
+}
+
+func (b *FilesystemBackend) GetCalendar(ctx context.Context, principal, calendar string) (*Calendar, error) {
+	dir := b.calendarDir(principal, calendar)
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	return &Calendar{Name: calendar, DisplayName: calendar}, nil
+}
+
+func (b *FilesystemBackend) CreateCalendar(ctx context.Context, principal, calendar string) error {
+	return os.MkdirAll(b.calendarDir(principal, calendar), 0755)
+}
+
+func (b *FilesystemBackend) DeleteCalendar(ctx context.Context, principal, calendar string) error {
+	return os.RemoveAll(b.calendarDir(principal, calendar))
+}
+
+func (b *FilesystemBackend) ListObjects(ctx context.Context, principal, calendar string) ([]Object, error) {
+	dir := b.calendarDir(principal, calendar)
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var objs []Object
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".ics") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, Object{UID: strings.TrimSuffix(e.Name(), ".ics"), Data: data})
+	}
+	sort.Slice(objs, func(i, j int) bool { return objs[i].UID < objs[j].UID })
+	return objs, nil
+}
+
+func (b *FilesystemBackend) GetObject(ctx context.Context, principal, calendar, uid string) (*Object, error) {
+	data, err := os.ReadFile(b.objectPath(principal, calendar, uid))
+	if err != nil {
+		return nil, err
+	}
+	return &Object{UID: uid, Data: data}, nil
+}
+
+func (b *FilesystemBackend) PutObject(ctx context.Context, principal, calendar, uid string, data []byte) error {
+	dir := b.calendarDir(principal, calendar)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(b.objectPath(principal, calendar, uid), data, 0644)
+}
+
+func (b *FilesystemBackend) PutObjectIfMatch(ctx context.Context, principal, calendar, uid string, data []byte, ifMatch, ifNoneMatch string) (string, error) {
+	dir := b.calendarDir(principal, calendar)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := b.objectPath(principal, calendar, uid)
+
+	existing, err := os.ReadFile(path)
+	exists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	switch {
+	case ifNoneMatch == "*":
+		if exists {
+			return "", ErrPreconditionFailed
+		}
+		// O_EXCL|O_CREATE makes the existence check and the create atomic,
+		// closing the race a plain Stat-then-WriteFile would leave open.
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, os.ErrExist) {
+			return "", ErrPreconditionFailed
+		}
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		if _, err := f.Write(data); err != nil {
+			return "", err
+		}
+
+	case ifMatch != "":
+		if !exists || ETag(existing) != ifMatch {
+			return "", ErrPreconditionFailed
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return "", err
+		}
+
+	default:
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return "", err
+		}
+	}
+
+	return ETag(data), nil
+}
+
+func (b *FilesystemBackend) DeleteObject(ctx context.Context, principal, calendar, uid string) error {
+	return os.Remove(b.objectPath(principal, calendar, uid))
+}
+
+// MergeCalendar reassembles a calendar's objects into a single VCALENDAR
+// document, suitable for returning from a whole-calendar GET. Each object is
+// itself a standalone VCALENDAR wrapping one VEVENT (see SplitVEVENTs); this
+// unwraps them and merges their VEVENTs under one VCALENDAR.
+func MergeCalendar(objs []Object) []byte {
+	cal := ical.NewCalendar()
+	cal.Props.SetText(ical.PropVersion, "2.0")
+	cal.Props.SetText(ical.PropProductID, "-//missing-minutes//caldav//EN")
+	for _, o := range objs {
+		events, err := decodeEvents(o.Data)
+		if err != nil {
+			continue
+		}
+		for _, event := range events {
+			cal.Children = append(cal.Children, event.Component)
+		}
+	}
+
+	var buf bytes.Buffer
+	ical.NewEncoder(&buf).Encode(cal)
+	return buf.Bytes()
+}
+
+// SplitVEVENTs parses a raw VCALENDAR document and returns one Object per
+// VEVENT it contains. Each Object's Data is itself a complete, standalone
+// VCALENDAR wrapping that single VEVENT, so it round-trips as a valid
+// iCalendar object on its own (as CalDAV requires for per-UID resources).
+// VEVENTs without a UID are skipped since they can't be addressed
+// individually.
+func SplitVEVENTs(data []byte) []Object {
+	events, err := decodeEvents(data)
+	if err != nil {
+		return nil
+	}
+
+	var objs []Object
+	for _, event := range events {
+		uid, err := event.Props.Text(ical.PropUID)
+		if err != nil || uid == "" {
+			continue
+		}
+		if event.Props.Get(ical.PropDateTimeStamp) == nil {
+			// go-ical's encoder requires exactly one DTSTAMP; clients that
+			// omit it (common for hand-written or legacy .ics files) would
+			// otherwise fail to encode below and get silently dropped.
+			event.Props.SetDateTime(ical.PropDateTimeStamp, time.Now())
+		}
+
+		single := ical.NewCalendar()
+		single.Props.SetText(ical.PropVersion, "2.0")
+		single.Props.SetText(ical.PropProductID, "-//missing-minutes//caldav//EN")
+		single.Children = []*ical.Component{event.Component}
+
+		var buf bytes.Buffer
+		if err := ical.NewEncoder(&buf).Encode(single); err != nil {
+			continue
+		}
+		objs = append(objs, Object{UID: uid, Data: buf.Bytes()})
+	}
+	return objs
+}
+
+// decodeEvents parses a VCALENDAR document and returns its VEVENTs.
+func decodeEvents(data []byte) ([]ical.Event, error) {
+	cal, err := ical.NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		return nil, err
+	}
+	return cal.Events(), nil
+}
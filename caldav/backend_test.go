@@ -0,0 +1,200 @@
+package caldav
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSplitVEVENTs(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		wantUIDs []string
+	}{
+		{
+			name: "single event",
+			data: "BEGIN:VCALENDAR\r\n" +
+				"VERSION:2.0\r\n" +
+				"BEGIN:VEVENT\r\n" +
+				"UID:ev1\r\n" +
+				"DTSTAMP:20260101T000000Z\r\n" +
+				"DTSTART:20260801T100000Z\r\n" +
+				"END:VEVENT\r\n" +
+				"END:VCALENDAR\r\n",
+			wantUIDs: []string{"ev1"},
+		},
+		{
+			name: "multiple events",
+			data: "BEGIN:VCALENDAR\r\n" +
+				"VERSION:2.0\r\n" +
+				"BEGIN:VEVENT\r\n" +
+				"UID:ev1\r\n" +
+				"DTSTAMP:20260101T000000Z\r\n" +
+				"DTSTART:20260801T100000Z\r\n" +
+				"END:VEVENT\r\n" +
+				"BEGIN:VEVENT\r\n" +
+				"UID:ev2\r\n" +
+				"DTSTAMP:20260101T000000Z\r\n" +
+				"DTSTART:20260802T100000Z\r\n" +
+				"END:VEVENT\r\n" +
+				"END:VCALENDAR\r\n",
+			wantUIDs: []string{"ev1", "ev2"},
+		},
+		{
+			name: "missing DTSTAMP is synthesized rather than dropped",
+			data: "BEGIN:VCALENDAR\r\n" +
+				"VERSION:2.0\r\n" +
+				"BEGIN:VEVENT\r\n" +
+				"UID:nodtstamp\r\n" +
+				"DTSTART:20260801T100000Z\r\n" +
+				"END:VEVENT\r\n" +
+				"END:VCALENDAR\r\n",
+			wantUIDs: []string{"nodtstamp"},
+		},
+		{
+			name: "event without UID is skipped",
+			data: "BEGIN:VCALENDAR\r\n" +
+				"VERSION:2.0\r\n" +
+				"BEGIN:VEVENT\r\n" +
+				"DTSTAMP:20260101T000000Z\r\n" +
+				"DTSTART:20260801T100000Z\r\n" +
+				"END:VEVENT\r\n" +
+				"END:VCALENDAR\r\n",
+			wantUIDs: nil,
+		},
+		{
+			name:     "unparseable body yields nothing",
+			data:     "not an icalendar document",
+			wantUIDs: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs := SplitVEVENTs([]byte(tt.data))
+			if len(objs) != len(tt.wantUIDs) {
+				t.Fatalf("SplitVEVENTs() returned %d objects, want %d", len(objs), len(tt.wantUIDs))
+			}
+			for i, uid := range tt.wantUIDs {
+				if objs[i].UID != uid {
+					t.Errorf("objs[%d].UID = %q, want %q", i, objs[i].UID, uid)
+				}
+				if !strings.Contains(string(objs[i].Data), "DTSTAMP") {
+					t.Errorf("objs[%d].Data missing synthesized DTSTAMP: %s", i, objs[i].Data)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeCalendar(t *testing.T) {
+	objs := SplitVEVENTs([]byte(
+		"BEGIN:VCALENDAR\r\n" +
+			"VERSION:2.0\r\n" +
+			"BEGIN:VEVENT\r\n" +
+			"UID:ev1\r\n" +
+			"DTSTAMP:20260101T000000Z\r\n" +
+			"DTSTART:20260801T100000Z\r\n" +
+			"END:VEVENT\r\n" +
+			"BEGIN:VEVENT\r\n" +
+			"UID:ev2\r\n" +
+			"DTSTAMP:20260101T000000Z\r\n" +
+			"DTSTART:20260802T100000Z\r\n" +
+			"END:VEVENT\r\n" +
+			"END:VCALENDAR\r\n"))
+	if len(objs) != 2 {
+		t.Fatalf("setup: SplitVEVENTs returned %d objects, want 2", len(objs))
+	}
+
+	merged := MergeCalendar(objs)
+	reparsed := SplitVEVENTs(merged)
+	if len(reparsed) != 2 {
+		t.Fatalf("MergeCalendar() round-trip produced %d VEVENTs, want 2: %s", len(reparsed), merged)
+	}
+	if !strings.Contains(string(merged), "BEGIN:VCALENDAR") || strings.Count(string(merged), "BEGIN:VEVENT") != 2 {
+		t.Errorf("MergeCalendar() did not produce a single VCALENDAR wrapping both VEVENTs: %s", merged)
+	}
+}
+
+func TestPutObjectIfMatch(t *testing.T) {
+	ctx := context.Background()
+	const principal, calendar, uid = "john", "work", "ev1"
+	const v1, v2 = "version one", "version two"
+
+	t.Run("If-None-Match * fails once the object exists", func(t *testing.T) {
+		b := NewFilesystemBackend(t.TempDir())
+		if _, err := b.PutObjectIfMatch(ctx, principal, calendar, uid, []byte(v1), "", "*"); err != nil {
+			t.Fatalf("initial create-only PUT: %v", err)
+		}
+		if _, err := b.PutObjectIfMatch(ctx, principal, calendar, uid, []byte(v2), "", "*"); !errors.Is(err, ErrPreconditionFailed) {
+			t.Errorf("second create-only PUT: got %v, want ErrPreconditionFailed", err)
+		}
+		obj, err := b.GetObject(ctx, principal, calendar, uid)
+		if err != nil || string(obj.Data) != v1 {
+			t.Errorf("object was overwritten despite failed precondition: data=%q err=%v", obj, err)
+		}
+	})
+
+	t.Run("If-Match succeeds against the current ETag", func(t *testing.T) {
+		b := NewFilesystemBackend(t.TempDir())
+		etag1, err := b.PutObjectIfMatch(ctx, principal, calendar, uid, []byte(v1), "", "")
+		if err != nil {
+			t.Fatalf("initial PUT: %v", err)
+		}
+		if _, err := b.PutObjectIfMatch(ctx, principal, calendar, uid, []byte(v2), etag1, ""); err != nil {
+			t.Fatalf("If-Match PUT with current ETag: %v", err)
+		}
+		obj, err := b.GetObject(ctx, principal, calendar, uid)
+		if err != nil || string(obj.Data) != v2 {
+			t.Errorf("If-Match PUT did not update the object: data=%q err=%v", obj, err)
+		}
+	})
+
+	t.Run("If-Match fails against a stale ETag", func(t *testing.T) {
+		b := NewFilesystemBackend(t.TempDir())
+		if _, err := b.PutObjectIfMatch(ctx, principal, calendar, uid, []byte(v1), "", ""); err != nil {
+			t.Fatalf("initial PUT: %v", err)
+		}
+		if _, err := b.PutObjectIfMatch(ctx, principal, calendar, uid, []byte(v2), `"stale-etag"`, ""); !errors.Is(err, ErrPreconditionFailed) {
+			t.Errorf("stale If-Match PUT: got %v, want ErrPreconditionFailed", err)
+		}
+	})
+
+	t.Run("If-Match fails when the object doesn't exist", func(t *testing.T) {
+		b := NewFilesystemBackend(t.TempDir())
+		if _, err := b.PutObjectIfMatch(ctx, principal, calendar, uid, []byte(v1), `"anything"`, ""); !errors.Is(err, ErrPreconditionFailed) {
+			t.Errorf("If-Match PUT against missing object: got %v, want ErrPreconditionFailed", err)
+		}
+	})
+
+	t.Run("no preconditions always succeeds", func(t *testing.T) {
+		b := NewFilesystemBackend(t.TempDir())
+		if _, err := b.PutObjectIfMatch(ctx, principal, calendar, uid, []byte(v1), "", ""); err != nil {
+			t.Fatalf("unconditional PUT: %v", err)
+		}
+		if _, err := b.PutObjectIfMatch(ctx, principal, calendar, uid, []byte(v2), "", ""); err != nil {
+			t.Fatalf("unconditional overwrite: %v", err)
+		}
+	})
+}
+
+func TestListCalendarsSkipsDotDirectories(t *testing.T) {
+	ctx := context.Background()
+	b := NewFilesystemBackend(t.TempDir())
+	if err := b.CreateCalendar(ctx, "john", "work"); err != nil {
+		t.Fatalf("CreateCalendar: %v", err)
+	}
+	if err := b.PutObject(ctx, "john", ".tokens", "google", []byte("{}")); err != nil {
+		t.Fatalf("seeding dot-directory: %v", err)
+	}
+
+	cals, err := b.ListCalendars(ctx, "john")
+	if err != nil {
+		t.Fatalf("ListCalendars: %v", err)
+	}
+	if len(cals) != 1 || cals[0].Name != "work" {
+		t.Errorf("ListCalendars() = %+v, want only the \"work\" calendar", cals)
+	}
+}
@@ -0,0 +1,455 @@
+package caldav
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CurrentUserPrincipalFunc resolves the authenticated principal (the
+// username) for an incoming request's context. The server wires this to the
+// same context value its basic-auth middleware sets, so the CalDAV URL
+// namespace (/{user}/...) lines up with the username already in use.
+type CurrentUserPrincipalFunc func(ctx context.Context) (string, error)
+
+// Handler serves the CalDAV namespace rooted at "/{user}/calendars/..." on
+// top of a Backend. Mount it for the methods it supports (OPTIONS, PROPFIND,
+// REPORT, MKCALENDAR, DELETE, PUT, GET on calendar/object resources); all
+// other methods should be routed elsewhere by the caller.
+type Handler struct {
+	Backend Backend
+	// CurrentUserPrincipal returns the authenticated username for a request.
+	CurrentUserPrincipal CurrentUserPrincipalFunc
+}
+
+// NewHandler returns a Handler backed by the given Backend.
+func NewHandler(backend Backend, principal CurrentUserPrincipalFunc) *Handler {
+	return &Handler{Backend: backend, CurrentUserPrincipal: principal}
+}
+
+// resource identifies what a request path refers to within the CalDAV tree.
+type resource struct {
+	principal string // e.g. "john"
+	kind      kind
+	calendar  string // set for kindCalendar and kindObject
+	uid       string // set for kindObject
+}
+
+type kind int
+
+const (
+	kindPrincipal kind = iota
+	kindHomeSet
+	kindCalendar
+	kindObject
+	kindUnknown
+)
+
+// parsePath maps "/{user}/calendars/{calendar}/{uid}.ics" (and the shorter
+// prefixes of it) onto a resource.
+func parsePath(path string) resource {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) == 0 || parts[0] == "" {
+		return resource{kind: kindUnknown}
+	}
+
+	r := resource{principal: parts[0]}
+	switch {
+	case len(parts) == 1:
+		r.kind = kindPrincipal
+	case len(parts) == 2 && parts[1] == "calendars":
+		r.kind = kindHomeSet
+	case len(parts) == 3 && parts[1] == "calendars":
+		r.kind = kindCalendar
+		r.calendar = parts[2]
+	case len(parts) == 4 && parts[1] == "calendars" && strings.HasSuffix(parts[3], ".ics"):
+		r.kind = kindObject
+		r.calendar = parts[2]
+		r.uid = strings.TrimSuffix(parts[3], ".ics")
+	default:
+		r.kind = kindUnknown
+	}
+	return r
+}
+
+// IsCalDAVPath reports whether path falls under the "/{user}/calendars/..."
+// namespace this handler owns, so callers can route GET/PUT/DELETE to it
+// instead of the legacy flat-file handlers.
+func IsCalDAVPath(path string) bool {
+	return parsePath(path).kind != kindUnknown
+}
+
+func (h *Handler) principal(r *http.Request) (string, error) {
+	if h.CurrentUserPrincipal == nil {
+		return "", fmt.Errorf("no CurrentUserPrincipal configured")
+	}
+	return h.CurrentUserPrincipal(r.Context())
+}
+
+// authorize ensures the authenticated user matches the principal segment of
+// the URL, mirroring the ownership check the legacy PUT handler performs.
+func (h *Handler) authorize(w http.ResponseWriter, r *http.Request, res resource) bool {
+	user, err := h.principal(r)
+	if err != nil || user == "" {
+		w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	if user != res.principal {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	res := parsePath(r.URL.Path)
+	if res.kind == kindUnknown {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case "OPTIONS":
+		h.handleOptions(w, r)
+	case "PROPFIND":
+		h.handlePropfind(w, r, res)
+	case "REPORT":
+		h.handleReport(w, r, res)
+	case "MKCALENDAR":
+		h.handleMkcalendar(w, r, res)
+	case http.MethodDelete:
+		h.handleDelete(w, r, res)
+	case http.MethodPut:
+		h.handlePut(w, r, res)
+	case http.MethodGet:
+		h.handleGet(w, r, res)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) handleOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("DAV", "1, 3, calendar-access")
+	w.Header().Set("Allow", "OPTIONS, GET, PUT, DELETE, PROPFIND, REPORT, MKCALENDAR")
+	w.WriteHeader(http.StatusOK)
+}
+
+func homeSetHref(principal string) string { return "/" + principal + "/calendars/" }
+func calendarHref(principal, calendar string) string {
+	return "/" + principal + "/calendars/" + calendar + "/"
+}
+func objectHref(principal, calendar, uid string) string {
+	return "/" + principal + "/calendars/" + calendar + "/" + uid + ".ics"
+}
+
+func (h *Handler) handlePropfind(w http.ResponseWriter, r *http.Request, res resource) {
+	if !h.authorize(w, r, res) {
+		return
+	}
+
+	depth := r.Header.Get("Depth")
+	var responses []response
+
+	switch res.kind {
+	case kindPrincipal:
+		responses = append(responses, response{
+			Href: "/" + res.principal + "/",
+			Propstat: []propstat{{
+				Status: "HTTP/1.1 200 OK",
+				Prop: prop{
+					CurrentUserPrincipal: &href{Href: "/" + res.principal + "/"},
+					CalendarHomeSet:      &href{Href: homeSetHref(res.principal)},
+					ResourceType:         &resourceType{Collection: &struct{}{}},
+				},
+			}},
+		})
+
+	case kindHomeSet:
+		responses = append(responses, response{
+			Href: homeSetHref(res.principal),
+			Propstat: []propstat{{
+				Status: "HTTP/1.1 200 OK",
+				Prop: prop{
+					DisplayName:  "calendars",
+					ResourceType: &resourceType{Collection: &struct{}{}},
+				},
+			}},
+		})
+		if depth == "1" {
+			cals, err := h.Backend.ListCalendars(r.Context(), res.principal)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			for _, c := range cals {
+				responses = append(responses, calendarResponse(res.principal, c))
+			}
+		}
+
+	case kindCalendar:
+		cal, err := h.Backend.GetCalendar(r.Context(), res.principal, res.calendar)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		responses = append(responses, calendarResponse(res.principal, *cal))
+		if depth == "1" {
+			objs, err := h.Backend.ListObjects(r.Context(), res.principal, res.calendar)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			for _, o := range objs {
+				responses = append(responses, objectResponse(res.principal, res.calendar, o))
+			}
+		}
+
+	case kindObject:
+		obj, err := h.Backend.GetObject(r.Context(), res.principal, res.calendar, res.uid)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		responses = append(responses, objectResponse(res.principal, res.calendar, *obj))
+	}
+
+	writeMultistatus(w, responses)
+}
+
+func calendarResponse(principal string, c Calendar) response {
+	return response{
+		Href: calendarHref(principal, c.Name),
+		Propstat: []propstat{{
+			Status: "HTTP/1.1 200 OK",
+			Prop: prop{
+				DisplayName:  c.DisplayName,
+				ResourceType: &resourceType{Collection: &struct{}{}, Calendar: &struct{}{}},
+			},
+		}},
+	}
+}
+
+func objectResponse(principal, calendar string, o Object) response {
+	return response{
+		Href: objectHref(principal, calendar, o.UID),
+		Propstat: []propstat{{
+			Status: "HTTP/1.1 200 OK",
+			Prop: prop{
+				GetETag:        ETag(o.Data),
+				GetContentType: "text/calendar; component=VEVENT",
+			},
+		}},
+	}
+}
+
+func writeMultistatus(w http.ResponseWriter, responses []response) {
+	ms := multistatus{Responses: responses}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(207) // Multi-Status
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Encode(ms)
+}
+
+// icalUTCLayout is the basic UTC date-time form RFC 4791 §9.9 requires for
+// a <time-range> filter's start/end attributes, e.g. "20060102T150405Z".
+const icalUTCLayout = "20060102T150405Z"
+
+// handleReport implements calendar-query and calendar-multiget by returning
+// calendar-data for either the objects matching the calendar-query's
+// <time-range> filter (if any) or the specific hrefs a multiget asked for.
+func (h *Handler) handleReport(w http.ResponseWriter, r *http.Request, res resource) {
+	if !h.authorize(w, r, res) {
+		return
+	}
+	if res.kind != kindCalendar {
+		http.Error(w, "REPORT is only supported on calendar collections", http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "could not read request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	var req reportRequest
+	isMultiget := strings.Contains(string(body), "calendar-multiget")
+	if isMultiget {
+		if err := xml.Unmarshal(body, &req); err != nil {
+			http.Error(w, "invalid REPORT body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var objs []Object
+	if isMultiget {
+		for _, hr := range req.Hrefs {
+			uid := strings.TrimSuffix(hr[strings.LastIndex(hr, "/")+1:], ".ics")
+			obj, err := h.Backend.GetObject(r.Context(), res.principal, res.calendar, uid)
+			if err == nil {
+				objs = append(objs, *obj)
+			}
+		}
+	} else {
+		objs, err = h.Backend.ListObjects(r.Context(), res.principal, res.calendar)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if tr, err := parseQueryTimeRange(body); err != nil {
+			http.Error(w, "invalid time-range filter", http.StatusBadRequest)
+			return
+		} else if tr != nil {
+			objs = FilterTimeRange(objs, tr.start, tr.end)
+		}
+	}
+
+	var responses []response
+	for _, o := range objs {
+		responses = append(responses, response{
+			Href: objectHref(res.principal, res.calendar, o.UID),
+			Propstat: []propstat{{
+				Status: "HTTP/1.1 200 OK",
+				Prop: prop{
+					GetETag:      ETag(o.Data),
+					CalendarData: string(o.Data),
+				},
+			}},
+		})
+	}
+	writeMultistatus(w, responses)
+}
+
+// queryTimeRange is the parsed form of a calendar-query's <time-range>
+// filter, in UTC.
+type queryTimeRange struct {
+	start, end time.Time
+}
+
+// parseQueryTimeRange looks for a <C:time-range> filter in a calendar-query
+// REPORT body and parses its start/end attributes. It returns a nil range
+// (not an error) when the body has no filter, or a filter with no
+// time-range leaf, since those are queries this server can still answer by
+// returning every object unfiltered.
+func parseQueryTimeRange(body []byte) (*queryTimeRange, error) {
+	if !strings.Contains(string(body), "time-range") {
+		return nil, nil
+	}
+
+	var req reportQueryRequest
+	if err := xml.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	tr := findTimeRange(req.Filter.CompFilter)
+	if tr == nil {
+		return nil, nil
+	}
+
+	start, err := time.Parse(icalUTCLayout, tr.Start)
+	if err != nil {
+		return nil, fmt.Errorf("time-range start: %w", err)
+	}
+	end, err := time.Parse(icalUTCLayout, tr.End)
+	if err != nil {
+		return nil, fmt.Errorf("time-range end: %w", err)
+	}
+	return &queryTimeRange{start: start, end: end}, nil
+}
+
+func (h *Handler) handleMkcalendar(w http.ResponseWriter, r *http.Request, res resource) {
+	if !h.authorize(w, r, res) {
+		return
+	}
+	if res.kind != kindCalendar {
+		http.Error(w, "MKCALENDAR requires a calendar path", http.StatusBadRequest)
+		return
+	}
+	if err := h.Backend.CreateCalendar(r.Context(), res.principal, res.calendar); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (h *Handler) handleDelete(w http.ResponseWriter, r *http.Request, res resource) {
+	if !h.authorize(w, r, res) {
+		return
+	}
+	var err error
+	switch res.kind {
+	case kindCalendar:
+		err = h.Backend.DeleteCalendar(r.Context(), res.principal, res.calendar)
+	case kindObject:
+		err = h.Backend.DeleteObject(r.Context(), res.principal, res.calendar, res.uid)
+	default:
+		http.Error(w, "cannot delete this resource", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) handlePut(w http.ResponseWriter, r *http.Request, res resource) {
+	if !h.authorize(w, r, res) {
+		return
+	}
+	if res.kind != kindObject {
+		http.Error(w, "PUT requires an event path", http.StatusBadRequest)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "could not read request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	newEtag, err := h.Backend.PutObjectIfMatch(r.Context(), res.principal, res.calendar, res.uid, body,
+		r.Header.Get("If-Match"), r.Header.Get("If-None-Match"))
+	if errors.Is(err, ErrPreconditionFailed) {
+		http.Error(w, "Precondition Failed", http.StatusPreconditionFailed)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("ETag", newEtag)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) handleGet(w http.ResponseWriter, r *http.Request, res resource) {
+	switch res.kind {
+	case kindObject:
+		obj, err := h.Backend.GetObject(r.Context(), res.principal, res.calendar, res.uid)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/calendar; component=VEVENT")
+		w.Header().Set("ETag", ETag(obj.Data))
+		w.Write(obj.Data)
+	case kindCalendar:
+		objs, err := h.Backend.ListObjects(r.Context(), res.principal, res.calendar)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		w.Write(MergeCalendar(objs))
+	default:
+		http.NotFound(w, r)
+	}
+}
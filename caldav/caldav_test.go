@@ -0,0 +1,74 @@
+package caldav
+
+import "testing"
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want resource
+	}{
+		{
+			name: "principal",
+			path: "/john/",
+			want: resource{principal: "john", kind: kindPrincipal},
+		},
+		{
+			name: "home set",
+			path: "/john/calendars",
+			want: resource{principal: "john", kind: kindHomeSet},
+		},
+		{
+			name: "calendar",
+			path: "/john/calendars/work/",
+			want: resource{principal: "john", kind: kindCalendar, calendar: "work"},
+		},
+		{
+			name: "object",
+			path: "/john/calendars/work/abc-123.ics",
+			want: resource{principal: "john", kind: kindObject, calendar: "work", uid: "abc-123"},
+		},
+		{
+			name: "object without .ics suffix is unknown",
+			path: "/john/calendars/work/abc-123",
+			want: resource{principal: "john", kind: kindUnknown},
+		},
+		{
+			name: "too many segments is unknown",
+			path: "/john/calendars/work/abc-123.ics/extra",
+			want: resource{principal: "john", kind: kindUnknown},
+		},
+		{
+			name: "empty path is unknown",
+			path: "/",
+			want: resource{kind: kindUnknown},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parsePath(tt.path)
+			if got != tt.want {
+				t.Errorf("parsePath(%q) = %+v, want %+v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsCalDAVPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/john/calendars/work/", true},
+		{"/john/calendars/work/abc.ics", true},
+		{"/john/work.ics", false},
+		{"/", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsCalDAVPath(tt.path); got != tt.want {
+			t.Errorf("IsCalDAVPath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
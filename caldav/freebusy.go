@@ -0,0 +1,130 @@
+package caldav
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+const freeBusyDateTimeFormat = "20060102T150405Z"
+
+// Interval is a closed-open [Start, End) busy period.
+type Interval struct {
+	Start time.Time
+	End   time.Time
+}
+
+// BusyIntervals walks objs and returns the coalesced busy periods that
+// overlap [start, end), expanding recurring events the same way
+// FilterTimeRange does. Events marked TRANSP:TRANSPARENT or
+// STATUS:CANCELLED are not considered busy, per RFC 5545 section 3.8.2.7.
+func BusyIntervals(objs []Object, start, end time.Time) []Interval {
+	var intervals []Interval
+	for _, o := range objs {
+		events, err := decodeEvents(o.Data)
+		if err != nil || len(events) == 0 {
+			continue
+		}
+		event := events[0]
+		if !countsAsBusy(event) {
+			continue
+		}
+
+		duration, starts, err := occurrenceStarts(event, start, end)
+		if err != nil {
+			continue
+		}
+		for _, occStart := range starts {
+			occEnd := occStart.Add(duration)
+			if !occEnd.After(occStart) {
+				occEnd = occStart
+			}
+			if iStart, iEnd, ok := clip(occStart, occEnd, start, end); ok {
+				intervals = append(intervals, Interval{Start: iStart, End: iEnd})
+			}
+		}
+	}
+	return coalesce(intervals)
+}
+
+func countsAsBusy(event ical.Event) bool {
+	if status, err := event.Status(); err == nil && status == ical.EventCancelled {
+		return false
+	}
+	if transp, err := event.Props.Text(ical.PropTransparency); err == nil && transp == "TRANSPARENT" {
+		return false
+	}
+	return true
+}
+
+func clip(aStart, aEnd, bStart, bEnd time.Time) (start, end time.Time, ok bool) {
+	if !intervalsOverlap(aStart, aEnd, bStart, bEnd) {
+		return time.Time{}, time.Time{}, false
+	}
+	if aStart.Before(bStart) {
+		aStart = bStart
+	}
+	if aEnd.After(bEnd) {
+		aEnd = bEnd
+	}
+	return aStart, aEnd, true
+}
+
+// coalesce sorts intervals by start and merges any that overlap or touch.
+func coalesce(intervals []Interval) []Interval {
+	if len(intervals) == 0 {
+		return nil
+	}
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i].Start.Before(intervals[j].Start) })
+
+	merged := []Interval{intervals[0]}
+	for _, cur := range intervals[1:] {
+		last := &merged[len(merged)-1]
+		if !cur.Start.After(last.End) {
+			if cur.End.After(last.End) {
+				last.End = cur.End
+			}
+			continue
+		}
+		merged = append(merged, cur)
+	}
+	return merged
+}
+
+// EncodeFreeBusy renders intervals as a standalone VCALENDAR containing one
+// VFREEBUSY component, with DTSTART/DTEND set to the query window. go-ical
+// doesn't model the PERIOD value type (see its ical.go TODO), so FREEBUSY
+// property values are built directly per RFC 5545 section 3.3.9
+// ("<start>/<end>" explicit periods).
+func EncodeFreeBusy(intervals []Interval, start, end time.Time) []byte {
+	cal := ical.NewCalendar()
+	cal.Props.SetText(ical.PropVersion, "2.0")
+	cal.Props.SetText(ical.PropProductID, "-//missing-minutes//caldav//EN")
+
+	fb := ical.NewComponent(ical.CompFreeBusy)
+	fb.Props.SetText(ical.PropUID, newFreeBusyUID())
+	fb.Props.SetDateTime(ical.PropDateTimeStamp, time.Now())
+	fb.Props.SetDateTime(ical.PropDateTimeStart, start)
+	fb.Props.SetDateTime(ical.PropDateTimeEnd, end)
+	for _, iv := range intervals {
+		prop := ical.NewProp(ical.PropFreeBusy)
+		prop.Params.Set("FBTYPE", "BUSY")
+		prop.Value = iv.Start.UTC().Format(freeBusyDateTimeFormat) + "/" + iv.End.UTC().Format(freeBusyDateTimeFormat)
+		fb.Props.Add(prop)
+	}
+	cal.Children = append(cal.Children, fb)
+
+	var buf bytes.Buffer
+	ical.NewEncoder(&buf).Encode(cal)
+	return buf.Bytes()
+}
+
+func newFreeBusyUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:]) + "@missing-minutes"
+}
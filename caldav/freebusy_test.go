@@ -0,0 +1,164 @@
+package caldav
+
+import (
+	"testing"
+	"time"
+)
+
+func mustParse(t *testing.T, s string) time.Time {
+	t.Helper()
+	tm, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatalf("time.Parse(%q): %v", s, err)
+	}
+	return tm
+}
+
+func TestCoalesce(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		in   []Interval
+		want []Interval
+	}{
+		{
+			name: "empty",
+			in:   nil,
+			want: nil,
+		},
+		{
+			name: "non-overlapping stays separate",
+			in: []Interval{
+				{Start: mustParse(t, "2026-08-01T10:00:00Z"), End: mustParse(t, "2026-08-01T11:00:00Z")},
+				{Start: mustParse(t, "2026-08-01T12:00:00Z"), End: mustParse(t, "2026-08-01T13:00:00Z")},
+			},
+			want: []Interval{
+				{Start: mustParse(t, "2026-08-01T10:00:00Z"), End: mustParse(t, "2026-08-01T11:00:00Z")},
+				{Start: mustParse(t, "2026-08-01T12:00:00Z"), End: mustParse(t, "2026-08-01T13:00:00Z")},
+			},
+		},
+		{
+			name: "overlapping merges",
+			in: []Interval{
+				{Start: mustParse(t, "2026-08-01T10:00:00Z"), End: mustParse(t, "2026-08-01T11:30:00Z")},
+				{Start: mustParse(t, "2026-08-01T11:00:00Z"), End: mustParse(t, "2026-08-01T12:00:00Z")},
+			},
+			want: []Interval{
+				{Start: mustParse(t, "2026-08-01T10:00:00Z"), End: mustParse(t, "2026-08-01T12:00:00Z")},
+			},
+		},
+		{
+			name: "touching (back-to-back) merges",
+			in: []Interval{
+				{Start: mustParse(t, "2026-08-01T10:00:00Z"), End: mustParse(t, "2026-08-01T11:00:00Z")},
+				{Start: mustParse(t, "2026-08-01T11:00:00Z"), End: mustParse(t, "2026-08-01T12:00:00Z")},
+			},
+			want: []Interval{
+				{Start: mustParse(t, "2026-08-01T10:00:00Z"), End: mustParse(t, "2026-08-01T12:00:00Z")},
+			},
+		},
+		{
+			name: "out of order input is sorted before merging",
+			in: []Interval{
+				{Start: mustParse(t, "2026-08-01T12:00:00Z"), End: mustParse(t, "2026-08-01T13:00:00Z")},
+				{Start: mustParse(t, "2026-08-01T10:00:00Z"), End: mustParse(t, "2026-08-01T11:00:00Z")},
+			},
+			want: []Interval{
+				{Start: mustParse(t, "2026-08-01T10:00:00Z"), End: mustParse(t, "2026-08-01T11:00:00Z")},
+				{Start: mustParse(t, "2026-08-01T12:00:00Z"), End: mustParse(t, "2026-08-01T13:00:00Z")},
+			},
+		},
+		{
+			name: "fully contained interval is absorbed",
+			in: []Interval{
+				{Start: mustParse(t, "2026-08-01T10:00:00Z"), End: mustParse(t, "2026-08-01T14:00:00Z")},
+				{Start: mustParse(t, "2026-08-01T11:00:00Z"), End: mustParse(t, "2026-08-01T12:00:00Z")},
+			},
+			want: []Interval{
+				{Start: mustParse(t, "2026-08-01T10:00:00Z"), End: mustParse(t, "2026-08-01T14:00:00Z")},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := coalesce(tt.in)
+			if len(got) != len(tt.want) {
+				t.Fatalf("coalesce() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Start.Equal(tt.want[i].Start) || !got[i].End.Equal(tt.want[i].End) {
+					t.Errorf("coalesce()[%d] = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func vevent(uid, dtstart, dtend, extra string) Object {
+	data := "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:" + uid + "\r\n" +
+		"DTSTAMP:20260101T000000Z\r\n" +
+		"DTSTART:" + dtstart + "\r\n" +
+		"DTEND:" + dtend + "\r\n" +
+		extra +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+	return Object{UID: uid, Data: []byte(data)}
+}
+
+func TestBusyIntervals(t *testing.T) {
+	start := mustParse(t, "2026-08-01T00:00:00Z")
+	end := mustParse(t, "2026-08-02T00:00:00Z")
+
+	tests := []struct {
+		name string
+		objs []Object
+		want []Interval
+	}{
+		{
+			name: "busy event in window",
+			objs: []Object{vevent("ev1", "20260801T100000Z", "20260801T110000Z", "")},
+			want: []Interval{{Start: mustParse(t, "2026-08-01T10:00:00Z"), End: mustParse(t, "2026-08-01T11:00:00Z")}},
+		},
+		{
+			name: "event outside window is excluded",
+			objs: []Object{vevent("ev1", "20270801T100000Z", "20270801T110000Z", "")},
+			want: nil,
+		},
+		{
+			name: "transparent event does not count as busy",
+			objs: []Object{vevent("ev1", "20260801T100000Z", "20260801T110000Z", "TRANSP:TRANSPARENT\r\n")},
+			want: nil,
+		},
+		{
+			name: "cancelled event does not count as busy",
+			objs: []Object{vevent("ev1", "20260801T100000Z", "20260801T110000Z", "STATUS:CANCELLED\r\n")},
+			want: nil,
+		},
+		{
+			name: "overlapping events coalesce into one interval",
+			objs: []Object{
+				vevent("ev1", "20260801T100000Z", "20260801T113000Z", ""),
+				vevent("ev2", "20260801T110000Z", "20260801T120000Z", ""),
+			},
+			want: []Interval{{Start: mustParse(t, "2026-08-01T10:00:00Z"), End: mustParse(t, "2026-08-01T12:00:00Z")}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := BusyIntervals(tt.objs, start, end)
+			if len(got) != len(tt.want) {
+				t.Fatalf("BusyIntervals() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Start.Equal(tt.want[i].Start) || !got[i].End.Equal(tt.want[i].End) {
+					t.Errorf("BusyIntervals()[%d] = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
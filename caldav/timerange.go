@@ -0,0 +1,107 @@
+package caldav
+
+import (
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+// maxOccurrences bounds how many instances of a recurring event are
+// expanded per query, so a pathological or unbounded RRULE can't make a
+// time-range query run away.
+const maxOccurrences = 1000
+
+// FilterTimeRange returns the subset of objs that have at least one
+// occurrence overlapping [start, end), expanding RRULE/RDATE recurrence and
+// honoring EXDATE exceptions. Non-recurring events are matched against their
+// own DTSTART/DTEND. Objects that fail to parse are skipped.
+func FilterTimeRange(objs []Object, start, end time.Time) []Object {
+	var matched []Object
+	for _, o := range objs {
+		events, err := decodeEvents(o.Data)
+		if err != nil || len(events) == 0 {
+			continue
+		}
+		if occursInRange(events[0], start, end) {
+			matched = append(matched, o)
+		}
+	}
+	return matched
+}
+
+// occursInRange reports whether event has an occurrence whose [start, end)
+// interval overlaps the query window.
+func occursInRange(event ical.Event, rangeStart, rangeEnd time.Time) bool {
+	duration, starts, err := occurrenceStarts(event, rangeStart, rangeEnd)
+	if err != nil {
+		return false
+	}
+	for _, occStart := range starts {
+		if intervalsOverlap(occStart, occStart.Add(duration), rangeStart, rangeEnd) {
+			return true
+		}
+	}
+	return false
+}
+
+// occurrenceStarts returns event's occurrence start times that fall at or
+// after rangeStart-duration and at or before rangeEnd, expanding
+// RRULE/RDATE recurrence (bounded by maxOccurrences) and honoring EXDATE.
+func occurrenceStarts(event ical.Event, rangeStart, rangeEnd time.Time) (time.Duration, []time.Time, error) {
+	dtstart, err := event.DateTimeStart(time.UTC)
+	if err != nil {
+		return 0, nil, err
+	}
+	duration := eventDuration(event, dtstart)
+
+	ruleSet, err := event.RecurrenceSet(time.UTC)
+	if err != nil {
+		return 0, nil, err
+	}
+	if ruleSet == nil {
+		// No RRULE. RDATE (if any) still needs expanding by hand, since
+		// go-ical's RecurrenceSet only builds a Set when RRULE is present.
+		starts := append(rdateOccurrences(event, time.UTC), dtstart)
+		return duration, starts, nil
+	}
+
+	// Bound expansion to the query window (plus one lookback window for
+	// events that start before it but still overlap) so an unbounded RRULE
+	// (e.g. FREQ=DAILY with no COUNT/UNTIL) can't expand forever.
+	lookback := rangeStart.Add(-duration)
+	starts := ruleSet.Between(lookback, rangeEnd, true)
+	if len(starts) > maxOccurrences {
+		starts = starts[:maxOccurrences]
+	}
+	return duration, starts, nil
+}
+
+// rdateOccurrences returns the RDATE instances of an event that has no
+// RRULE (and so isn't covered by Component.RecurrenceSet).
+func rdateOccurrences(event ical.Event, loc *time.Location) []time.Time {
+	var times []time.Time
+	for _, prop := range event.Props[ical.PropRecurrenceDates] {
+		t, err := prop.DateTime(loc)
+		if err != nil {
+			continue
+		}
+		times = append(times, t)
+	}
+	return times
+}
+
+// eventDuration returns DTEND-DTSTART, or zero if the event has no DTEND.
+func eventDuration(event ical.Event, dtstart time.Time) time.Duration {
+	dtend, err := event.DateTimeEnd(time.UTC)
+	if err != nil || dtend.IsZero() || !dtend.After(dtstart) {
+		return 0
+	}
+	return dtend.Sub(dtstart)
+}
+
+func intervalsOverlap(aStart, aEnd, bStart, bEnd time.Time) bool {
+	if !aEnd.After(aStart) {
+		aEnd = aStart // zero-duration events still count at their instant
+	}
+	return aStart.Before(bEnd) && bStart.Before(aEnd)
+}
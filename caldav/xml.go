@@ -0,0 +1,94 @@
+package caldav
+
+import "encoding/xml"
+
+// The handful of WebDAV/CalDAV XML elements this package needs to read and
+// write. Namespaces follow RFC 4918 ("DAV:") and RFC 4791 ("urn:ietf:params:xml:ns:caldav").
+
+type multistatus struct {
+	XMLName   xml.Name   `xml:"DAV: multistatus"`
+	Responses []response `xml:"response"`
+}
+
+type response struct {
+	Href     string     `xml:"href"`
+	Propstat []propstat `xml:"propstat"`
+}
+
+type propstat struct {
+	Prop   prop   `xml:"prop"`
+	Status string `xml:"status"`
+}
+
+// prop carries only the properties this server understands. Unknown
+// properties requested by clients are simply omitted from the response.
+//
+// Fields with no explicit namespace in their tag inherit none of their own,
+// so they're emitted in multistatus's default "DAV:" namespace; the
+// CalDAV-defined properties (RFC 4791) need their namespace spelled out
+// explicitly or clients that key off namespace (Thunderbird, Apple
+// Calendar, DAVx5) won't recognize them.
+type prop struct {
+	ResourceType         *resourceType `xml:"resourcetype,omitempty"`
+	DisplayName          string        `xml:"displayname,omitempty"`
+	GetETag              string        `xml:"getetag,omitempty"`
+	GetContentType       string        `xml:"getcontenttype,omitempty"`
+	CurrentUserPrincipal *href         `xml:"current-user-principal,omitempty"`
+	CalendarHomeSet      *href         `xml:"urn:ietf:params:xml:ns:caldav calendar-home-set,omitempty"`
+	CalendarData         string        `xml:"urn:ietf:params:xml:ns:caldav calendar-data,omitempty"`
+}
+
+type resourceType struct {
+	Collection *struct{} `xml:"collection,omitempty"`
+	Calendar   *struct{} `xml:"urn:ietf:params:xml:ns:caldav calendar,omitempty"`
+}
+
+type href struct {
+	Href string `xml:"href"`
+}
+
+// reportRequest covers the two REPORT bodies this server supports:
+// calendar-query and calendar-multiget.
+type reportRequest struct {
+	XMLName xml.Name `xml:""`
+	Hrefs   []string `xml:"href"`
+}
+
+// calendarQueryFilter is the <C:filter> body of a calendar-query REPORT
+// (RFC 4791 §9.7). Only the nested comp-filter chain and a time-range
+// leaf are modeled, since that's the one filter shape this server applies;
+// other filters (prop-filter, text-match, param-filter) are left unmatched.
+type calendarQueryFilter struct {
+	CompFilter compFilter `xml:"comp-filter"`
+}
+
+type compFilter struct {
+	Name       string      `xml:"name,attr"`
+	CompFilter *compFilter `xml:"comp-filter"`
+	TimeRange  *timeRange  `xml:"time-range"`
+}
+
+type timeRange struct {
+	Start string `xml:"start,attr"`
+	End   string `xml:"end,attr"`
+}
+
+// reportQueryRequest captures just the <C:filter> of a calendar-query body;
+// the <D:prop> half is ignored since this server always returns getetag and
+// calendar-data regardless of what was asked for.
+type reportQueryRequest struct {
+	XMLName xml.Name            `xml:""`
+	Filter  calendarQueryFilter `xml:"filter"`
+}
+
+// findTimeRange walks a comp-filter chain looking for a nested time-range,
+// the way a calendar-query body nests VCALENDAR > VEVENT > time-range.
+func findTimeRange(cf compFilter) *timeRange {
+	if cf.TimeRange != nil {
+		return cf.TimeRange
+	}
+	if cf.CompFilter != nil {
+		return findTimeRange(*cf.CompFilter)
+	}
+	return nil
+}
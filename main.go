@@ -4,37 +4,60 @@
 // This server follows the KISS (Keep It Simple, Stupid) philosophy.
 //
 // ## Endpoints:
-// - GET  /{username}/{calendar}.ics : Public, read-only access to a calendar.
-// - PUT  /{username}/{calendar}.ics : Authenticated endpoint to create or update a calendar.
+//   - GET  /{username}/{calendar}.ics : Public, read-only access to a calendar.
+//     Accepts optional "start"/"end" RFC3339 query parameters to return only
+//     the VEVENTs occurring in that window (recurring events included).
+//   - PUT  /{username}/{calendar}.ics : Authenticated endpoint to create or update a calendar.
+//   - GET  /{username}/{calendar}/{uid}.ics : Public access to a single event.
+//
+// ## CalDAV:
+//   - The "/{username}/calendars/..." namespace speaks CalDAV (RFC 4791):
+//     OPTIONS, PROPFIND and REPORT for discovery/sync, MKCALENDAR to create a
+//     calendar collection, and PUT/GET/DELETE on individual
+//     "{uid}.ics" events. This lets clients like Thunderbird, Apple Calendar
+//     and DAVx5 discover and sync calendars instead of only fetching flat
+//     files. See the caldav package for the implementation.
 //
 // ## Authentication:
-// - Uses HTTP Basic Authentication for PUT requests.
-// - Users and passwords are now loaded from a `users.json` file.
+//   - Uses HTTP Basic Authentication for PUT requests (and other mutating
+//     CalDAV methods).
+//   - The backend is pluggable via the `auth` package; select it with the
+//     MM_AUTH environment variable:
+//   - MM_AUTH unset or "file": bcrypt-hashed credentials in `users.json`
+//     (the default; see `auth.FromEnv` for the others' settings).
+//   - MM_AUTH=imap, MM_AUTH=ldap, MM_AUTH=pam: defer to an existing IMAP,
+//     LDAP, or PAM identity system instead of a local password file.
+//
+// ## Google Calendar sync:
+//   - Set MM_GOOGLE_CLIENT_ID, MM_GOOGLE_CLIENT_SECRET, MM_GOOGLE_REDIRECT_URL
+//     and MM_TOKEN_ENCRYPTION_KEY (32 bytes, hex-encoded) to let users mirror
+//     their Google Calendar into a local "google" calendar: POST
+//     /{username}/sync/google/authorize (authenticated) returns a consent
+//     URL, and GET /{username}/sync/google/callback completes it. A
+//     background goroutine re-syncs every authorized user every 6 hours;
+//     see the sync package for the implementation. This is pull-only: local
+//     edits to the synced calendar aren't pushed back to Google.
 //
 // ## Storage:
 // - iCal files are stored directly on the filesystem in a 'calendars' directory.
 // - The structure is: ./calendars/{username}/{calendar}.ics
 //
 // ## How to Run:
-// 1. Save this code as `main.go`.
-// 2. Create a file named `users.json` in the same directory.
-//    Example `users.json` content:
-//    {
-//      "john": "password123",
-//      "jane": "anotherpassword"
-//    }
-// 3. Create a directory named `calendars`.
-// 4. Run the server: `go run main.go`
-// 5. The server will start on `http://localhost:8080`.
+//  1. Save this code as `main.go`.
+//  2. Run the server once with no `users.json` present; it writes a starter
+//     file with bcrypt-hashed default passwords and exits so you can edit
+//     it with real credentials (see auth.FileProvider for the file format).
+//  3. Create a directory named `calendars`.
+//  4. Run the server: `go run main.go`
+//  5. The server will start on `http://localhost:8080`.
 //
 // ## Example Usage (with curl):
 //
-// 1. Create/Update a calendar for user 'john':
-//    curl -X PUT --user "john:password123" --header "Content-Type: text/calendar" --data "@path/to/your/local/event.ics" http://localhost:8080/john/work.ics
-//
-// 2. Read the calendar (no authentication needed):
-//    curl http://localhost:8080/john/work.ics
+//  1. Create/Update a calendar for user 'john':
+//     curl -X PUT --user "john:password123" --header "Content-Type: text/calendar" --data "@path/to/your/local/event.ics" http://localhost:8080/john/work.ics
 //
+//  2. Read the calendar (no authentication needed):
+//     curl http://localhost:8080/john/work.ics
 package main
 
 import (
@@ -45,12 +68,27 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/tellmeY18/missing-minutes/auth"
+	"github.com/tellmeY18/missing-minutes/caldav"
+	gsync "github.com/tellmeY18/missing-minutes/sync"
 )
 
-// users will be populated from the users.json file.
-var users map[string]string
+// authProvider authenticates Basic Auth credentials; see auth.FromEnv.
+var authProvider auth.Provider
+
+// dav serves the CalDAV namespace ("/{user}/calendars/...") on top of the
+// same calendars directory used by the legacy flat-file endpoints.
+var dav *caldav.Handler
+
+// googleSync drives Google Calendar sync (see the "## Google Calendar
+// sync" doc section above); it's nil when the required environment
+// variables aren't set, in which case the sync endpoints answer 501.
+var googleSync *gsync.GoogleSync
 
 const (
 	// dataDir is the directory where all calendar files will be stored.
@@ -59,51 +97,98 @@ const (
 	serverPort = "8080"
 	// userFile is the name of the file containing user credentials.
 	userFile = "users.json"
+	// googleCalendarName is the local calendar a user's Google Calendar is
+	// mirrored into.
+	googleCalendarName = "google"
+	// googleRefreshInterval is how often the background goroutine re-syncs
+	// every authorized user's Google Calendar.
+	googleRefreshInterval = 6 * time.Hour
 )
 
-// loadUsers reads the specified file and unmarshals the JSON content
-// into the global 'users' map.
-func loadUsers(file string) error {
-	data, err := os.ReadFile(file)
+// setupAuthProvider resolves the auth.Provider selected by MM_AUTH (see
+// auth.FromEnv). For the default file backend it bootstraps a fresh
+// users.json with bcrypt-hashed default credentials on first run, just like
+// loadUsers used to, then exits so the operator can edit it before trusting
+// it.
+func setupAuthProvider() auth.Provider {
+	if backend := os.Getenv("MM_AUTH"); backend == "" || backend == "file" {
+		if _, err := os.Stat(userFile); os.IsNotExist(err) {
+			log.Printf("User file '%s' not found.", userFile)
+			if err := writeDefaultUserFile(userFile); err != nil {
+				log.Fatalf("Could not write default user file: %v", err)
+			}
+			log.Fatalf("A default '%s' has been created. Please edit it with real credentials and restart the server.", userFile)
+		}
+	}
+
+	provider, err := auth.FromEnv(userFile)
 	if err != nil {
-		return fmt.Errorf("could not read user file '%s': %w", file, err)
+		log.Fatalf("Failed to configure authentication: %v", err)
+	}
+	return provider
+}
+
+// writeDefaultUserFile writes a starter users.json with bcrypt-hashed
+// passwords, in the format auth.FileProvider expects.
+func writeDefaultUserFile(path string) error {
+	defaultUsers := map[string]string{
+		"user1": "changeme",
+		"user2": "pleasereset",
+	}
+	hashed := make(map[string]string, len(defaultUsers))
+	for name, pass := range defaultUsers {
+		hash, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		hashed[name] = string(hash)
+	}
+	data, err := json.MarshalIndent(hashed, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// setupGoogleSync builds the GoogleSync used by the sync endpoints from the
+// MM_GOOGLE_CLIENT_ID / MM_GOOGLE_CLIENT_SECRET / MM_GOOGLE_REDIRECT_URL /
+// MM_TOKEN_ENCRYPTION_KEY environment variables, and starts its background
+// refresh goroutine. Returns nil, leaving the feature disabled, if any of
+// them are unset.
+func setupGoogleSync(backend caldav.Backend) *gsync.GoogleSync {
+	clientID := os.Getenv("MM_GOOGLE_CLIENT_ID")
+	clientSecret := os.Getenv("MM_GOOGLE_CLIENT_SECRET")
+	redirectURL := os.Getenv("MM_GOOGLE_REDIRECT_URL")
+	keyHex := os.Getenv("MM_TOKEN_ENCRYPTION_KEY")
+	if clientID == "" || clientSecret == "" || redirectURL == "" || keyHex == "" {
+		log.Printf("Google Calendar sync disabled: set MM_GOOGLE_CLIENT_ID, MM_GOOGLE_CLIENT_SECRET, MM_GOOGLE_REDIRECT_URL and MM_TOKEN_ENCRYPTION_KEY to enable it.")
+		return nil
 	}
 
-	// Unmarshal the JSON data into the users map.
-	err = json.Unmarshal(data, &users)
+	key, err := gsync.KeyFromHex(keyHex)
 	if err != nil {
-		return fmt.Errorf("could not parse user file '%s' as JSON: %w", file, err)
+		log.Fatalf("Invalid MM_TOKEN_ENCRYPTION_KEY: %v", err)
 	}
 
-	log.Printf("Successfully loaded %d users from %s", len(users), file)
-	return nil
+	gs := gsync.NewGoogleSync(backend, gsync.NewTokenStore(dataDir, key), clientID, clientSecret, redirectURL)
+	gs.RunBackgroundRefresh(context.Background(), googleRefreshInterval)
+	return gs
 }
 
 func main() {
-	// Attempt to load users from the JSON file.
-	if err := loadUsers(userFile); err != nil {
-		// If the file doesn't exist, create a default one and exit with instructions.
-		if os.IsNotExist(err) {
-			log.Printf("User file '%s' not found.", userFile)
-			defaultUsers := map[string]string{
-				"user1": "changeme",
-				"user2": "pleasereset",
-			}
-			defaultData, _ := json.MarshalIndent(defaultUsers, "", "  ")
-			if writeErr := os.WriteFile(userFile, defaultData, 0644); writeErr != nil {
-				log.Fatalf("Could not write default user file: %v", writeErr)
-			}
-			log.Fatalf("A default '%s' has been created. Please edit it with real credentials and restart the server.", userFile)
-		}
-		// For any other error (e.g., bad JSON), exit fatally.
-		log.Fatalf("Failed to load users: %v", err)
-	}
+	authProvider = setupAuthProvider()
 
 	// Ensure the main data directory exists before starting.
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
 		log.Fatalf("Failed to create data directory '%s': %v", dataDir, err)
 	}
 
+	// Wire the CalDAV handler to the same basic-auth context the legacy PUT
+	// endpoint uses, so the URL namespace stays consistent between the two.
+	backend := caldav.NewFilesystemBackend(dataDir)
+	dav = caldav.NewHandler(backend, currentUserPrincipal)
+	googleSync = setupGoogleSync(backend)
+
 	// Register the root handler to serve index.html
 	http.HandleFunc("/", rootHandler)
 
@@ -129,9 +214,50 @@ func rootHandler(w http.ResponseWriter, r *http.Request) {
 // calendarHandler is the main router. It inspects the request method and URL
 // and delegates to the appropriate handler function.
 func calendarHandler(w http.ResponseWriter, r *http.Request) {
+	if user, ok := parseGoogleAuthorizePath(r.URL.Path); ok && r.Method == http.MethodPost {
+		authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+			handleGoogleAuthorize(w, r, user)
+		})(w, r)
+		return
+	}
+	if user, ok := parseGoogleCallbackPath(r.URL.Path); ok && r.Method == http.MethodGet {
+		handleGoogleCallback(w, r, user)
+		return
+	}
+
+	// CalDAV methods always belong to the dav handler; GET/PUT/DELETE only
+	// belong to it when the path falls under "/{user}/calendars/...".
+	if isCalDAVMethod(r.Method) || caldav.IsCalDAVPath(r.URL.Path) {
+		switch r.Method {
+		case "OPTIONS", http.MethodGet:
+			// Discovery (OPTIONS) and reads are public, like the legacy GET endpoint.
+			dav.ServeHTTP(w, r)
+		case "PROPFIND", "REPORT", "MKCALENDAR", http.MethodPut, http.MethodDelete:
+			// These mutate state or reveal private data, so require authentication.
+			authMiddleware(dav.ServeHTTP)(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
+		if user, calendarName, ok := parseFreeBusyPath(r.URL.Path); ok {
+			handleFreeBusy(w, r, user, calendarName)
+			return
+		}
+		if user, calendarName, uid, ok := parseEventPath(r.URL.Path); ok {
+			handleGetEvent(w, r, user, calendarName, uid)
+			return
+		}
 		handleGetCalendar(w, r)
+	case http.MethodPost:
+		if user, calendarName, ok := parseFreeBusyPath(r.URL.Path); ok {
+			handleFreeBusy(w, r, user, calendarName)
+			return
+		}
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 	case http.MethodPut:
 		// Wrap the PUT handler with our authentication middleware.
 		authMiddleware(handlePutCalendar)(w, r)
@@ -141,66 +267,332 @@ func calendarHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleGetCalendar serves a calendar file to the client.
-// This is a public endpoint and requires no authentication.
-func handleGetCalendar(w http.ResponseWriter, r *http.Request) {
-	path := r.URL.Path
+// isCalDAVMethod reports whether m is one of the WebDAV/CalDAV verbs that
+// only the caldav package knows how to handle, regardless of path shape.
+func isCalDAVMethod(m string) bool {
+	switch m {
+	case "PROPFIND", "REPORT", "MKCALENDAR":
+		return true
+	default:
+		return false
+	}
+}
 
-	// Basic validation: ensure the path looks like a calendar file request.
+// parseCalendarPath splits "/{username}/{calendar}.ics" into its parts.
+func parseCalendarPath(path string) (user, calendar string, ok bool) {
 	if !strings.HasSuffix(path, ".ics") {
-		http.NotFound(w, r)
+		return "", "", false
+	}
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], strings.TrimSuffix(parts[1], ".ics"), true
+}
+
+// parseEventPath splits "/{username}/{calendar}/{uid}.ics" into its parts.
+func parseEventPath(path string) (user, calendar, uid string, ok bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 3 || !strings.HasSuffix(parts[2], ".ics") {
+		return "", "", "", false
+	}
+	return parts[0], parts[1], strings.TrimSuffix(parts[2], ".ics"), true
+}
+
+// parseGoogleAuthorizePath splits "/{username}/sync/google/authorize".
+func parseGoogleAuthorizePath(path string) (user string, ok bool) {
+	return splitSingleSegmentPath(path, "/sync/google/authorize")
+}
+
+// parseGoogleCallbackPath splits "/{username}/sync/google/callback".
+func parseGoogleCallbackPath(path string) (user string, ok bool) {
+	return splitSingleSegmentPath(path, "/sync/google/callback")
+}
+
+// splitSingleSegmentPath strips suffix from path and reports whether what's
+// left is a single non-empty path segment (the username).
+func splitSingleSegmentPath(path, suffix string) (user string, ok bool) {
+	if !strings.HasSuffix(path, suffix) {
+		return "", false
+	}
+	user = strings.Trim(strings.TrimSuffix(path, suffix), "/")
+	if user == "" || strings.Contains(user, "/") {
+		return "", false
+	}
+	return user, true
+}
+
+// handleGoogleAuthorize returns the Google consent URL for user to
+// authorize Google Calendar sync. authMiddleware has already verified the
+// caller's credentials; this also checks they match the user in the path,
+// the same rule handlePutCalendar uses for editing a calendar.
+func handleGoogleAuthorize(w http.ResponseWriter, r *http.Request, user string) {
+	if googleSync == nil {
+		http.Error(w, "Google Calendar sync is not configured", http.StatusNotImplemented)
+		return
+	}
+	authUser, ok := r.Context().Value("user").(string)
+	if !ok || authUser != user {
+		http.Error(w, "Forbidden. You can only authorize sync for your own account.", http.StatusForbidden)
 		return
 	}
 
-	// Construct the full file path and clean it to prevent directory traversal attacks.
-	filePath := filepath.Join(dataDir, filepath.Clean(path))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"url": googleSync.AuthorizeURL(user)})
+}
 
-	// Check if the file exists.
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+// handleGoogleCallback completes the OAuth2 flow Google redirects back to
+// after the user grants consent, then runs an initial sync so events show
+// up immediately instead of waiting for the next background refresh.
+func handleGoogleCallback(w http.ResponseWriter, r *http.Request, user string) {
+	if googleSync == nil {
+		http.Error(w, "Google Calendar sync is not configured", http.StatusNotImplemented)
+		return
+	}
+
+	state := r.URL.Query().Get("state")
+	code := r.URL.Query().Get("code")
+	if state == "" || code == "" {
+		http.Error(w, "missing code or state", http.StatusBadRequest)
+		return
+	}
+	if state != user {
+		http.Error(w, "state does not match the authorizing user", http.StatusBadRequest)
+		return
+	}
+
+	if err := googleSync.Callback(r.Context(), user, googleCalendarName, code); err != nil {
+		log.Printf("Error completing Google sync authorization for %s: %v", user, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := googleSync.SyncUser(r.Context(), user, googleCalendarName); err != nil {
+		log.Printf("Error running initial Google sync for %s: %v", user, err)
+	}
+
+	fmt.Fprintf(w, "Google Calendar sync authorized for %s. You can close this window.\n", user)
+}
+
+// handleGetCalendar reassembles a user's calendar from its individually
+// stored events and serves it as one VCALENDAR document. This is a public
+// endpoint and requires no authentication.
+//
+// If both "start" and "end" query parameters are given (RFC3339
+// timestamps), only VEVENTs with an occurrence in that window are included,
+// mirroring the CalDAV time-range REPORT filter; this expands RRULE/RDATE
+// recurrences bounded by the window.
+func handleGetCalendar(w http.ResponseWriter, r *http.Request) {
+	user, calendarName, ok := parseCalendarPath(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	objs, err := dav.Backend.ListObjects(r.Context(), user, calendarName)
+	if err != nil {
+		log.Printf("Error listing events for %s/%s: %v", user, calendarName, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if objs == nil {
 		http.NotFound(w, r)
 		return
 	}
 
-	// Set the correct Content-Type header for iCalendar files.
+	if start, end, ok, err := parseTimeRange(r); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if ok {
+		objs = caldav.FilterTimeRange(objs, start, end)
+		w.Header().Set("Content-Type", "text/calendar; component=VEVENT")
+		w.Write(caldav.MergeCalendar(objs))
+		return
+	}
+
 	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
-	http.ServeFile(w, r, filePath)
+	w.Write(caldav.MergeCalendar(objs))
 }
 
-// handlePutCalendar creates or updates a calendar file.
-// This function assumes authentication has already been handled by middleware.
-func handlePutCalendar(w http.ResponseWriter, r *http.Request) {
-	path := r.URL.Path
+// parseTimeRange reads the "start"/"end" RFC3339 query parameters used by
+// the time-range filter. ok is false if neither is set; an error is
+// returned if either is set but isn't valid RFC3339.
+func parseTimeRange(r *http.Request) (start, end time.Time, ok bool, err error) {
+	startParam := r.URL.Query().Get("start")
+	endParam := r.URL.Query().Get("end")
+	if startParam == "" && endParam == "" {
+		return time.Time{}, time.Time{}, false, nil
+	}
 
-	// Basic validation: ensure the path looks like a calendar file request.
-	if !strings.HasSuffix(path, ".ics") {
-		http.Error(w, "Invalid path. Must end with .ics", http.StatusBadRequest)
+	start, err = time.Parse(time.RFC3339, startParam)
+	if err != nil {
+		return time.Time{}, time.Time{}, false, fmt.Errorf("invalid start: %w", err)
+	}
+	end, err = time.Parse(time.RFC3339, endParam)
+	if err != nil {
+		return time.Time{}, time.Time{}, false, fmt.Errorf("invalid end: %w", err)
+	}
+	return start, end, true, nil
+}
+
+// parseFreeBusyPath splits "/{username}/{calendar}.ics/freebusy" into its
+// parts.
+func parseFreeBusyPath(path string) (user, calendar string, ok bool) {
+	const suffix = "/freebusy"
+	if !strings.HasSuffix(path, suffix) {
+		return "", "", false
+	}
+	return parseCalendarPath(strings.TrimSuffix(path, suffix))
+}
+
+// freeBusyRequest is the body of a POST free/busy request: an additional set
+// of calendars to merge in alongside the one named in the URL.
+type freeBusyRequest struct {
+	Calendars []struct {
+		User     string `json:"user"`
+		Calendar string `json:"calendar"`
+	} `json:"calendars"`
+}
+
+// freeBusyPeriod is one entry of the "Accept: application/json" alternative
+// to the default VFREEBUSY response.
+type freeBusyPeriod struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Status string    `json:"status"`
+}
+
+// handleFreeBusy answers GET/POST .../freebusy?start=…&end=… with the
+// coalesced busy intervals for a calendar, encoded as a VFREEBUSY component
+// by default or as a JSON array when the client sends
+// "Accept: application/json".
+//
+// A plain request (no "merge" parameter, no POST body) is public, like the
+// other GET endpoints. A merge request needs every referenced calendar to
+// belong to the authenticated caller: there's no ACL model in this server
+// to decide whose busy schedule someone else is entitled to see, so the
+// only safe default is restricting merges to the caller's own calendars.
+func handleFreeBusy(w http.ResponseWriter, r *http.Request, user, calendarName string) {
+	start, end, ok, err := parseTimeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !ok {
+		http.Error(w, "start and end query parameters are required", http.StatusBadRequest)
 		return
 	}
 
-	// Extract username from the path to verify ownership.
-	// Path format: /{username}/{calendar}.ics
-	parts := strings.Split(strings.Trim(path, "/"), "/")
-	if len(parts) < 2 {
-		http.Error(w, "Invalid path format. Expected /{username}/{calendar}.ics", http.StatusBadRequest)
+	type calRef struct{ user, calendar string }
+	refs := []calRef{{user, calendarName}}
+
+	if merge := r.URL.Query().Get("merge"); merge != "" {
+		for _, u := range strings.Split(merge, ",") {
+			if u = strings.TrimSpace(u); u != "" {
+				refs = append(refs, calRef{u, calendarName})
+			}
+		}
+	}
+
+	if r.Method == http.MethodPost && r.Body != nil {
+		var body freeBusyRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		for _, c := range body.Calendars {
+			refs = append(refs, calRef{c.User, c.Calendar})
+		}
+	}
+
+	if len(refs) > 1 {
+		authUser, ok, err := authenticateRequest(r)
+		if err != nil {
+			log.Printf("Error authenticating freebusy request: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		for _, ref := range refs {
+			if ref.user != authUser {
+				http.Error(w, "Forbidden. Free/busy merges can only include your own calendars.", http.StatusForbidden)
+				return
+			}
+		}
+	}
+
+	var objs []caldav.Object
+	for _, ref := range refs {
+		o, err := dav.Backend.ListObjects(r.Context(), ref.user, ref.calendar)
+		if err != nil {
+			log.Printf("Error listing events for freebusy %s/%s: %v", ref.user, ref.calendar, err)
+			continue
+		}
+		objs = append(objs, o...)
+	}
+
+	busy := caldav.BusyIntervals(objs, start, end)
+
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		periods := make([]freeBusyPeriod, len(busy))
+		for i, iv := range busy {
+			periods[i] = freeBusyPeriod{Start: iv.Start, End: iv.End, Status: "busy"}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(periods)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Write(caldav.EncodeFreeBusy(busy, start, end))
+}
+
+// handleGetEvent serves a single stored VEVENT, addressed by UID. This is a
+// public endpoint and requires no authentication.
+func handleGetEvent(w http.ResponseWriter, r *http.Request, user, calendarName, uid string) {
+	obj, err := dav.Backend.GetObject(r.Context(), user, calendarName, uid)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; component=VEVENT")
+	w.Header().Set("ETag", caldav.ETag(obj.Data))
+	w.Write(obj.Data)
+}
+
+// handlePutCalendar replaces a user's calendar. The uploaded VCALENDAR is
+// split into individual VEVENTs (see the caldav package) and each one is
+// stored under its own UID, so concurrent edits and the CalDAV namespace can
+// address events individually instead of only as an opaque blob.
+// This function assumes authentication has already been handled by middleware.
+func handlePutCalendar(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+	user, calendarName, ok := parseCalendarPath(path)
+	if !ok {
+		http.Error(w, "Invalid path. Must end with .ics", http.StatusBadRequest)
 		return
 	}
 
 	// The username from the URL must match the authenticated user.
 	// The authenticated user's name is passed via the request context from the middleware.
 	authUser, ok := r.Context().Value("user").(string)
-	if !ok || authUser != parts[0] {
+	if !ok || authUser != user {
 		http.Error(w, "Forbidden. You can only edit your own calendars.", http.StatusForbidden)
 		return
 	}
 
-	// Construct the full file path.
-	filePath := filepath.Join(dataDir, filepath.Clean(path))
-	dir := filepath.Dir(filePath)
-
-	// Create the user's directory if it doesn't exist.
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		log.Printf("Error creating directory %s: %v", dir, err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	// This endpoint replaces the whole calendar in one shot, so a single
+	// If-Match/If-None-Match can't stand in for the ETags of the N
+	// independent per-UID objects it's about to write. Conditional PUT is
+	// only meaningful against one object at a time, so it's only supported
+	// on the per-event CalDAV resource (PUT under "/{user}/calendars/...");
+	// reject rather than silently ignore the headers here.
+	if r.Header.Get("If-Match") != "" || r.Header.Get("If-None-Match") != "" {
+		http.Error(w, "If-Match/If-None-Match are not supported on the bulk calendar PUT; use the per-event CalDAV resource instead", http.StatusBadRequest)
 		return
 	}
 
@@ -213,34 +605,70 @@ func handlePutCalendar(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
-	// Write the data to the file, creating it or overwriting it.
-	err = os.WriteFile(filePath, body, 0644)
+	events := caldav.SplitVEVENTs(body)
+	if len(events) == 0 {
+		http.Error(w, "No storable VEVENTs found in request body", http.StatusBadRequest)
+		return
+	}
+
+	// A bulk PUT replaces the whole calendar, so drop any previously stored
+	// event that isn't part of this upload.
+	existing, err := dav.Backend.ListObjects(r.Context(), user, calendarName)
 	if err != nil {
-		log.Printf("Error writing file %s: %v", filePath, err)
+		log.Printf("Error listing existing events for %s/%s: %v", user, calendarName, err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
+	keep := make(map[string]bool, len(events))
+	for _, o := range events {
+		keep[o.UID] = true
+	}
+	for _, o := range existing {
+		if !keep[o.UID] {
+			if err := dav.Backend.DeleteObject(r.Context(), user, calendarName, o.UID); err != nil {
+				log.Printf("Error deleting stale event %s/%s/%s: %v", user, calendarName, o.UID, err)
+			}
+		}
+	}
 
-	log.Printf("Updated calendar: %s", filePath)
+	for _, o := range events {
+		if err := dav.Backend.PutObject(r.Context(), user, calendarName, o.UID, o.Data); err != nil {
+			log.Printf("Error writing event %s/%s/%s: %v", user, calendarName, o.UID, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	log.Printf("Updated calendar: %s/%s (%d events)", user, calendarName, len(events))
 	w.WriteHeader(http.StatusNoContent) // Success, no content to return.
 }
 
+// authenticateRequest validates the HTTP Basic credentials on r against the
+// configured auth.Provider, returning the authenticated username. ok is
+// false both when no credentials were supplied and when they were rejected;
+// err is only set when the backend itself couldn't be reached.
+func authenticateRequest(r *http.Request) (user string, ok bool, err error) {
+	username, password, present := r.BasicAuth()
+	if !present {
+		return "", false, nil
+	}
+	valid, err := authProvider.Authenticate(username, password)
+	if err != nil {
+		return "", false, err
+	}
+	return username, valid, nil
+}
+
 // authMiddleware is a simple middleware to handle HTTP Basic Authentication.
 func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Get the username and password from the Authorization header.
-		username, password, ok := r.BasicAuth()
-
-		// If credentials are not provided or are malformed, request them.
-		if !ok {
-			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		username, ok, err := authenticateRequest(r)
+		if err != nil {
+			log.Printf("Error authenticating request: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
-
-		// Check if the user exists and the password is correct.
-		expectedPassword, userExists := users[username]
-		if !userExists || expectedPassword != password {
+		if !ok {
 			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
@@ -248,10 +676,20 @@ func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 
 		// Authentication successful.
 		// Add the username to the request context so the next handler knows who is logged in.
-		ctx := r.Context()
-		ctx = context.WithValue(ctx, "user", username)
+		ctx := context.WithValue(r.Context(), "user", username)
 
 		// Call the next handler in the chain with the modified request.
 		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
+
+// currentUserPrincipal extracts the username authMiddleware stashed in the
+// request context. It's passed to the caldav package so CurrentUserPrincipal
+// lookups use the exact same identity as the rest of the server.
+func currentUserPrincipal(ctx context.Context) (string, error) {
+	user, ok := ctx.Value("user").(string)
+	if !ok {
+		return "", fmt.Errorf("no authenticated user in context")
+	}
+	return user, nil
+}
@@ -0,0 +1,230 @@
+// Package sync pulls events from external calendar providers into the
+// local caldav.Backend, so a user can expose a calendar they actually live
+// in (currently just Google Calendar) through this server's CalDAV and
+// flat-file endpoints without hosting events here directly.
+//
+// This first pass only pulls: it keeps the local mirror current via
+// Google's incremental syncToken API, but doesn't push local edits back to
+// Google. Doing that safely needs a way to tell a locally-made change from
+// one that just arrived from Google, which the current Backend interface
+// has no room for; left as future work rather than bolted on here.
+package sync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	calendar "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/option"
+
+	"github.com/tellmeY18/missing-minutes/caldav"
+)
+
+// GoogleSync coordinates OAuth2 authorization and incremental sync against
+// a user's Google Calendar.
+type GoogleSync struct {
+	Backend caldav.Backend
+	Tokens  *TokenStore
+	OAuth   *oauth2.Config
+}
+
+// NewGoogleSync returns a GoogleSync that stores events in backend and
+// tokens in tokens, using the given OAuth2 client credentials.
+func NewGoogleSync(backend caldav.Backend, tokens *TokenStore, clientID, clientSecret, redirectURL string) *GoogleSync {
+	return &GoogleSync{
+		Backend: backend,
+		Tokens:  tokens,
+		OAuth: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Scopes:       []string{calendar.CalendarReadonlyScope},
+			Endpoint:     google.Endpoint,
+		},
+	}
+}
+
+// AuthorizeURL returns the Google consent screen URL for user. user is
+// threaded through as the OAuth "state" parameter so Callback knows whose
+// token it's completing.
+func (s *GoogleSync) AuthorizeURL(user string) string {
+	return s.OAuth.AuthCodeURL(user, oauth2.AccessTypeOffline, oauth2.ApprovalForce)
+}
+
+// Callback completes the OAuth2 flow for user, exchanging code for a token
+// and persisting it via Tokens.
+func (s *GoogleSync) Callback(ctx context.Context, user, calendarName, code string) error {
+	token, err := s.OAuth.Exchange(ctx, code)
+	if err != nil {
+		return fmt.Errorf("sync: google token exchange: %w", err)
+	}
+	return s.Tokens.Save(user, calendarName, token)
+}
+
+// SyncUser pulls new, changed, and cancelled events from user's primary
+// Google Calendar into calendarName, using Google's incremental syncToken
+// API so repeat calls only fetch what's changed since the last one.
+func (s *GoogleSync) SyncUser(ctx context.Context, user, calendarName string) error {
+	token, err := s.Tokens.Load(user, calendarName)
+	if err != nil {
+		return fmt.Errorf("sync: loading google token for %s: %w", user, err)
+	}
+
+	client := s.OAuth.Client(ctx, token)
+	svc, err := calendar.NewService(ctx, option.WithHTTPClient(client))
+	if err != nil {
+		return fmt.Errorf("sync: building google calendar client: %w", err)
+	}
+
+	syncToken, err := s.Tokens.LoadSyncToken(user, calendarName)
+	if err != nil {
+		return fmt.Errorf("sync: loading sync token for %s: %w", user, err)
+	}
+
+	call := svc.Events.List("primary")
+	if syncToken != "" {
+		call = call.SyncToken(syncToken)
+	} else {
+		// First sync: ask for cancelled events too, so a calendar that's
+		// had deletions since before this server ever synced it doesn't
+		// leave stale local copies behind.
+		call = call.ShowDeleted(true)
+	}
+
+	var nextSyncToken string
+	err = call.Pages(ctx, func(page *calendar.Events) error {
+		for _, ev := range page.Items {
+			if err := s.applyEvent(ctx, user, calendarName, ev); err != nil {
+				return err
+			}
+		}
+		if page.NextSyncToken != "" {
+			nextSyncToken = page.NextSyncToken
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("sync: listing google events for %s: %w", user, err)
+	}
+	if nextSyncToken == "" {
+		return nil
+	}
+	return s.Tokens.SaveSyncToken(user, calendarName, nextSyncToken)
+}
+
+func (s *GoogleSync) applyEvent(ctx context.Context, user, calendarName string, ev *calendar.Event) error {
+	if ev.Status == "cancelled" {
+		err := s.Backend.DeleteObject(ctx, user, calendarName, ev.Id)
+		if err != nil {
+			// The event may never have been mirrored locally; either way
+			// the end state (no local copy) is what cancellation wants.
+			return nil
+		}
+		return nil
+	}
+
+	data, err := encodeGoogleEvent(ev)
+	if err != nil {
+		return fmt.Errorf("sync: encoding google event %s: %w", ev.Id, err)
+	}
+	return s.Backend.PutObject(ctx, user, calendarName, ev.Id, data)
+}
+
+// RunBackgroundRefresh starts a goroutine that re-syncs every
+// {user, calendar} pair with a stored token on a fixed interval, so mirrors
+// stay current even between the webhook-less polls a client's own GET
+// requests would trigger. It returns immediately; cancel ctx to stop it.
+func (s *GoogleSync) RunBackgroundRefresh(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.refreshAll(ctx)
+			}
+		}
+	}()
+}
+
+func (s *GoogleSync) refreshAll(ctx context.Context) {
+	pairs, err := s.Tokens.ListTokens()
+	if err != nil {
+		log.Printf("sync: listing google sync tokens: %v", err)
+		return
+	}
+	for _, pair := range pairs {
+		if err := s.SyncUser(ctx, pair.User, pair.Calendar); err != nil {
+			log.Printf("sync: refreshing %s/%s: %v", pair.User, pair.Calendar, err)
+		}
+	}
+}
+
+// encodeGoogleEvent converts a Google Calendar event into a standalone
+// VCALENDAR wrapping one VEVENT, matching the on-disk object format
+// caldav.SplitVEVENTs produces, so synced events are indistinguishable from
+// ones a client PUT directly.
+func encodeGoogleEvent(ev *calendar.Event) ([]byte, error) {
+	comp := ical.NewComponent(ical.CompEvent)
+	comp.Props.SetText(ical.PropUID, ev.Id)
+	if ev.Summary != "" {
+		comp.Props.SetText(ical.PropSummary, ev.Summary)
+	}
+
+	stamp := time.Now()
+	if ev.Updated != "" {
+		if t, err := time.Parse(time.RFC3339, ev.Updated); err == nil {
+			stamp = t
+		}
+	}
+	comp.Props.SetDateTime(ical.PropDateTimeStamp, stamp)
+
+	start, allDay, err := googleDateTime(ev.Start)
+	if err != nil {
+		return nil, fmt.Errorf("start: %w", err)
+	}
+	end, _, err := googleDateTime(ev.End)
+	if err != nil {
+		return nil, fmt.Errorf("end: %w", err)
+	}
+	if allDay {
+		comp.Props.SetDate(ical.PropDateTimeStart, start)
+		comp.Props.SetDate(ical.PropDateTimeEnd, end)
+	} else {
+		comp.Props.SetDateTime(ical.PropDateTimeStart, start)
+		comp.Props.SetDateTime(ical.PropDateTimeEnd, end)
+	}
+
+	cal := ical.NewCalendar()
+	cal.Props.SetText(ical.PropVersion, "2.0")
+	cal.Props.SetText(ical.PropProductID, "-//missing-minutes//caldav//EN")
+	cal.Children = []*ical.Component{comp}
+
+	var buf bytes.Buffer
+	if err := ical.NewEncoder(&buf).Encode(cal); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// googleDateTime reads a calendar.EventDateTime, which is either a
+// timed RFC3339 DateTime or an all-day Date ("2006-01-02").
+func googleDateTime(dt *calendar.EventDateTime) (t time.Time, allDay bool, err error) {
+	if dt == nil {
+		return time.Time{}, false, fmt.Errorf("missing date/time")
+	}
+	if dt.DateTime != "" {
+		t, err = time.Parse(time.RFC3339, dt.DateTime)
+		return t, false, err
+	}
+	t, err = time.Parse("2006-01-02", dt.Date)
+	return t, true, err
+}
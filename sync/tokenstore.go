@@ -0,0 +1,187 @@
+package sync
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// UserCalendar identifies one synced calendar owned by a principal.
+type UserCalendar struct {
+	User     string
+	Calendar string
+}
+
+// TokenStore persists per-user Google OAuth2 tokens encrypted at rest under
+// RootDir/{user}/.tokens/, plus the incremental-sync syncToken the calendar
+// API hands back between syncs. The syncToken isn't sensitive, so it's kept
+// unencrypted alongside the token.
+type TokenStore struct {
+	RootDir string
+	key     [32]byte // AES-256-GCM key
+}
+
+// NewTokenStore returns a TokenStore rooted at rootDir, encrypting tokens
+// with key. See KeyFromHex for loading one from an environment variable.
+func NewTokenStore(rootDir string, key [32]byte) *TokenStore {
+	return &TokenStore{RootDir: rootDir, key: key}
+}
+
+// KeyFromHex decodes a 64-character hex string (32 raw bytes, e.g. from
+// `openssl rand -hex 32`) into an AES-256 key.
+func KeyFromHex(s string) ([32]byte, error) {
+	var key [32]byte
+	raw, err := hex.DecodeString(s)
+	if err != nil {
+		return key, fmt.Errorf("sync: invalid token encryption key: %w", err)
+	}
+	if len(raw) != len(key) {
+		return key, fmt.Errorf("sync: token encryption key must be 32 bytes (64 hex chars), got %d", len(raw))
+	}
+	copy(key[:], raw)
+	return key, nil
+}
+
+func (s *TokenStore) tokensDir(user string) string {
+	return filepath.Join(s.RootDir, filepath.Clean("/"+user), ".tokens")
+}
+
+func (s *TokenStore) tokenPath(user, calendarName string) string {
+	return filepath.Join(s.tokensDir(user), filepath.Clean("/"+calendarName)+".json")
+}
+
+func (s *TokenStore) syncTokenPath(user, calendarName string) string {
+	return filepath.Join(s.tokensDir(user), filepath.Clean("/"+calendarName)+".synctoken")
+}
+
+// Save encrypts and persists token for user/calendarName.
+func (s *TokenStore) Save(user, calendarName string, token *oauth2.Token) error {
+	plain, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	ciphertext, err := s.encrypt(plain)
+	if err != nil {
+		return err
+	}
+	path := s.tokenPath(user, calendarName)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, ciphertext, 0600)
+}
+
+// Load decrypts and returns the stored token for user/calendarName.
+func (s *TokenStore) Load(user, calendarName string) (*oauth2.Token, error) {
+	ciphertext, err := os.ReadFile(s.tokenPath(user, calendarName))
+	if err != nil {
+		return nil, err
+	}
+	plain, err := s.decrypt(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	var token oauth2.Token
+	if err := json.Unmarshal(plain, &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// SaveSyncToken persists Google's incremental-sync token for the next
+// SyncUser call.
+func (s *TokenStore) SaveSyncToken(user, calendarName, syncToken string) error {
+	path := s.syncTokenPath(user, calendarName)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(syncToken), 0600)
+}
+
+// LoadSyncToken returns the last-saved sync token, or "" if none has been
+// stored yet, in which case the next sync should do a full listing.
+func (s *TokenStore) LoadSyncToken(user, calendarName string) (string, error) {
+	data, err := os.ReadFile(s.syncTokenPath(user, calendarName))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// ListTokens returns every {user, calendar} pair that currently has a
+// stored token, so the background refresher knows what to re-sync.
+func (s *TokenStore) ListTokens() ([]UserCalendar, error) {
+	userDirs, err := os.ReadDir(s.RootDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var out []UserCalendar
+	for _, u := range userDirs {
+		if !u.IsDir() {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(s.RootDir, u.Name(), ".tokens"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+				continue
+			}
+			out = append(out, UserCalendar{User: u.Name(), Calendar: strings.TrimSuffix(e.Name(), ".json")})
+		}
+	}
+	return out, nil
+}
+
+func (s *TokenStore) encrypt(plain []byte) ([]byte, error) {
+	gcm, err := s.gcm()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, nil), nil
+}
+
+func (s *TokenStore) decrypt(ciphertext []byte) ([]byte, error) {
+	gcm, err := s.gcm()
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("sync: token ciphertext too short")
+	}
+	nonce, data := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, data, nil)
+}
+
+func (s *TokenStore) gcm() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(s.key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}